@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+	"github.com/kkdai/youtube/v2"
+)
+
+type importYouTubeRequest struct {
+	VideoID    uuid.UUID `json:"video_id"`
+	YoutubeURL string    `json:"youtube_url"`
+}
+
+// handlerImportYouTube lets a client register a video by YouTube URL
+// instead of uploading a file from the browser. It resolves the best
+// progressive mp4 stream and runs it through the same
+// temp-file -> aspect-ratio -> faststart -> S3 pipeline as
+// handlerUploadVideo.
+func (cfg *apiConfig) handlerImportYouTube(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+
+	userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	var params importYouTubeRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode request body", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(params.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find video", err)
+		return
+	}
+
+	if video.UserID != userId {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	client := youtube.Client{}
+
+	ytVideo, err := client.GetVideo(params.YoutubeURL)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't resolve YouTube video", err)
+		return
+	}
+
+	formats := ytVideo.Formats.Type("video/mp4").WithAudioChannels()
+	if len(formats) == 0 {
+		respondWithError(w, http.StatusBadRequest, "No progressive mp4 stream available for this video", nil)
+		return
+	}
+	best := formats.Sort()[0]
+
+	stream, _, err := client.GetStream(ytVideo, &best)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open YouTube stream", err)
+		return
+	}
+	defer stream.Close()
+
+	temp, err := os.CreateTemp("", "tubely-youtube.mp4")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save file", err)
+		return
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	const maxUploadSize = 1 << 30 // same 1GiB cap as browser uploads
+
+	// io.LimitReader alone can't tell a source that's exactly the cap
+	// from one that's larger, since io.Copy sees a clean io.EOF either
+	// way. Read one byte past the cap so we can detect and reject the
+	// truncated case instead of silently saving a partial .mp4.
+	limited := io.LimitReader(stream, maxUploadSize+1)
+	written, err := io.Copy(temp, limited)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't download YouTube video", err)
+		return
+	}
+	if written > maxUploadSize {
+		respondWithError(w, http.StatusBadRequest, "YouTube video exceeds the 1GiB upload limit", nil)
+		return
+	}
+
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset file pointer", err)
+		return
+	}
+
+	ratio, err := cfg.getVideoAspectRatio(r.Context(), temp.Name())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get the video's aspect ratio", err)
+		return
+	}
+
+	var prefix string
+	switch ratio {
+	case "16:9":
+		prefix = "landscape"
+	case "9:16":
+		prefix = "portrait"
+	default:
+		prefix = "other"
+	}
+
+	fastStart, err := cfg.processVideoForFastStart(r.Context(), temp.Name())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't move flag to beginning", err)
+		return
+	}
+	defer os.Remove(fastStart)
+
+	processedFile, err := os.Open(fastStart)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open processed file", err)
+		return
+	}
+	defer processedFile.Close()
+
+	randBytes := make([]byte, 16)
+	if _, err := rand.Read(randBytes); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate filename", err)
+		return
+	}
+
+	key := fmt.Sprintf("%s/%x.mp4", prefix, randBytes)
+
+	uploader := NewMultipartUploader(cfg.s3Client, cfg.s3Bucket, key, "video/mp4", cfg.s3PartSize, cfg.s3PartConcurrency)
+	if err := uploader.Upload(r.Context(), processedFile, nil); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't put object in bucket", err)
+		return
+	}
+
+	s3URL := fmt.Sprintf("%s/%s", cfg.s3CfDistribution, key)
+	video.VideoURL = &s3URL
+
+	if video.Title == "" {
+		video.Title = ytVideo.Title
+	}
+	if video.Description == "" {
+		video.Description = ytVideo.Description
+	}
+
+	if thumbnailURL, err := cfg.importYouTubeThumbnail(r.Context(), ytVideo, prefix, randBytes); err != nil {
+		log.Printf("couldn't import YouTube thumbnail for video %s: %v", params.VideoID, err)
+	} else {
+		video.ThumbnailURL = &thumbnailURL
+	}
+
+	if err := cfg.db.UpdateVideo(video); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+// importYouTubeThumbnail downloads the source video's YouTube thumbnail
+// and re-uploads it to our own bucket, so the video record doesn't point
+// at a third party URL that could disappear.
+func (cfg *apiConfig) importYouTubeThumbnail(ctx context.Context, ytVideo *youtube.Video, prefix string, randBytes []byte) (string, error) {
+	if len(ytVideo.Thumbnails) == 0 {
+		return "", fmt.Errorf("video has no thumbnails")
+	}
+	thumb := ytVideo.Thumbnails[len(ytVideo.Thumbnails)-1] // largest is last
+
+	resp, err := http.Get(thumb.URL)
+	if err != nil {
+		return "", fmt.Errorf("couldn't fetch thumbnail: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("thumbnail fetch returned status %d", resp.StatusCode)
+	}
+
+	out, err := os.CreateTemp("", "tubely-yt-thumb.jpg")
+	if err != nil {
+		return "", fmt.Errorf("couldn't create temp file: %w", err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return "", fmt.Errorf("couldn't save thumbnail: %w", err)
+	}
+
+	return cfg.uploadPosterFrame(ctx, out.Name(), "thumbnails", prefix, randBytes, "")
+}
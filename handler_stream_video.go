@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/hls"
+	"github.com/google/uuid"
+)
+
+// handlerStreamVideo serves HLS playlists and chunks for a previously
+// uploaded video at GET /video/{videoID}/{quality}/{file}, where file is
+// either "index.m3u8" (the variant playlist) or "chunk-N.ts". The
+// top-level master playlist is served separately by
+// handlerStreamMasterPlaylist.
+func (cfg *apiConfig) handlerStreamVideo(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse video uuid", err)
+		return
+	}
+
+	qualityName := r.PathValue("quality")
+	file := r.PathValue("file")
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video has no source to stream", nil)
+		return
+	}
+
+	if file == "index.m3u8" {
+		cfg.serveVariantPlaylist(w, r, videoIDString, qualityName)
+		return
+	}
+
+	n, err := chunkIndex(file)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chunk name", err)
+		return
+	}
+
+	quality, err := findQuality(qualityName)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unknown quality tier", err)
+		return
+	}
+
+	probe, err := cfg.ffmpeg.Probe(r.Context(), *video.VideoURL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't probe source video", err)
+		return
+	}
+	if !qualityFitsSource(quality, probe.Height) {
+		respondWithError(w, http.StatusBadRequest, "Quality tier exceeds source resolution", nil)
+		return
+	}
+	if n < 0 || n >= hls.NumChunks(probe.Duration) {
+		respondWithError(w, http.StatusBadRequest, "Chunk index out of range", nil)
+		return
+	}
+
+	mgr := hls.GetManager(videoIDString, *video.VideoURL, cfg.hlsCacheDir, quality)
+	chunkPath, err := mgr.Chunk(n)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't produce chunk", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "video/mp2t")
+	http.ServeFile(w, r, chunkPath)
+}
+
+// handlerStreamMasterPlaylist serves the top-level .m3u8 at
+// GET /video/{videoID}/master.m3u8, advertising only the quality tiers that
+// fit under the source video's resolution.
+func (cfg *apiConfig) handlerStreamMasterPlaylist(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse video uuid", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video has no source to stream", nil)
+		return
+	}
+
+	probe, err := cfg.ffmpeg.Probe(r.Context(), *video.VideoURL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't probe source video", err)
+		return
+	}
+
+	tiers := hls.BuildLadder(probe.Height)
+	if len(tiers) == 0 {
+		respondWithError(w, http.StatusInternalServerError, "No quality tiers fit this video", nil)
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("#EXTM3U\n")
+	for _, q := range tiers {
+		bandwidth := bitrateToBandwidth(q.Bitrate)
+		sb.WriteString(fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n", bandwidth, q.Width, q.Height))
+		sb.WriteString(fmt.Sprintf("%s/index.m3u8\n", q.Name))
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Write([]byte(sb.String()))
+}
+
+// serveVariantPlaylist writes a fixed-duration-chunk media playlist for
+// one quality tier. It lists every chunk up front, with the count taken
+// from the source's probed duration; none of the chunks need exist yet,
+// since they're produced lazily on request.
+func (cfg *apiConfig) serveVariantPlaylist(w http.ResponseWriter, r *http.Request, videoIDString, qualityName string) {
+	quality, err := findQuality(qualityName)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unknown quality tier", err)
+		return
+	}
+
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse video uuid", err)
+		return
+	}
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video has no source to stream", nil)
+		return
+	}
+
+	probe, err := cfg.ffmpeg.Probe(r.Context(), *video.VideoURL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't probe source video", err)
+		return
+	}
+	if !qualityFitsSource(quality, probe.Height) {
+		respondWithError(w, http.StatusBadRequest, "Quality tier exceeds source resolution", nil)
+		return
+	}
+
+	numChunks := hls.NumChunks(probe.Duration)
+
+	var sb strings.Builder
+	sb.WriteString("#EXTM3U\n")
+	sb.WriteString("#EXT-X-VERSION:3\n")
+	sb.WriteString(fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", hls.ChunkDuration))
+	sb.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	for n := 0; n < numChunks; n++ {
+		sb.WriteString(fmt.Sprintf("#EXTINF:%d,\n", hls.ChunkDuration))
+		sb.WriteString(fmt.Sprintf("chunk-%d.ts\n", n))
+	}
+	sb.WriteString("#EXT-X-ENDLIST\n")
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Write([]byte(sb.String()))
+}
+
+func findQuality(name string) (hls.Quality, error) {
+	for _, q := range hls.Ladder {
+		if q.Name == name {
+			return q, nil
+		}
+	}
+	return hls.Quality{}, fmt.Errorf("no such quality tier: %s", name)
+}
+
+// qualityFitsSource reports whether quality is one of the tiers
+// hls.BuildLadder would actually offer for a source of sourceHeight, so
+// callers reject a tier name that exists in hls.Ladder generally but
+// would require upscaling this particular video.
+func qualityFitsSource(quality hls.Quality, sourceHeight int) bool {
+	for _, q := range hls.BuildLadder(sourceHeight) {
+		if q.Name == quality.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func chunkIndex(file string) (int, error) {
+	name := strings.TrimSuffix(file, ".ts")
+	name = strings.TrimPrefix(name, "chunk-")
+	n, err := strconv.Atoi(name)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't parse chunk index from %q: %w", file, err)
+	}
+	return n, nil
+}
+
+// bitrateToBandwidth converts an ffmpeg-style bitrate string like
+// "2800k" into the raw bits-per-second value HLS's BANDWIDTH attribute
+// expects.
+func bitrateToBandwidth(bitrate string) int {
+	n, err := strconv.Atoi(strings.TrimSuffix(bitrate, "k"))
+	if err != nil {
+		return 0
+	}
+	return n * 1000
+}
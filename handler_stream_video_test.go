@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestChunkIndex(t *testing.T) {
+	tests := []struct {
+		file    string
+		want    int
+		wantErr bool
+	}{
+		{"chunk-0.ts", 0, false},
+		{"chunk-42.ts", 42, false},
+		{"index.m3u8", 0, true},
+		{"chunk-abc.ts", 0, true},
+		{"chunk-.ts", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := chunkIndex(tt.file)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("chunkIndex(%q) = %d, nil; want error", tt.file, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("chunkIndex(%q) returned unexpected error: %v", tt.file, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("chunkIndex(%q) = %d, want %d", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestBitrateToBandwidth(t *testing.T) {
+	tests := []struct {
+		bitrate string
+		want    int
+	}{
+		{"800k", 800_000},
+		{"18000k", 18_000_000},
+		{"not-a-bitrate", 0},
+	}
+
+	for _, tt := range tests {
+		if got := bitrateToBandwidth(tt.bitrate); got != tt.want {
+			t.Errorf("bitrateToBandwidth(%q) = %d, want %d", tt.bitrate, got, tt.want)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
@@ -10,7 +10,6 @@ import (
 	"mime"
 	"net/http"
 	"os"
-	"os/exec"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -75,28 +74,39 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 
 	defer temp.Close()
 
-	if _, err := io.Copy(temp, file); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't copy file", err)
+	// Everything from here on streams progress back to the client as
+	// ndjson, so this is the last point we can still fail with a normal
+	// JSON error response - headers are about to be committed.
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+
+	progress := &progressReader{r: file, total: header.Size, onProgress: func(bytesDone, bytesTotal int64) {
+		writeProgressEvent(w, flusher, "copy-to-temp", bytesDone, bytesTotal)
+	}}
+	if _, err := io.Copy(temp, progress); err != nil {
+		writeErrorEvent(w, flusher, "copy-to-temp", err)
 		return
 	}
 
 	if _, err := temp.Seek(0, io.SeekStart); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't reset file pointer", err)
+		writeErrorEvent(w, flusher, "copy-to-temp", err)
 		return
 	}
 
 	randBytes := make([]byte, 16)
 	_, err = rand.Read(randBytes)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't generate filename", err)
+		writeErrorEvent(w, flusher, "copy-to-temp", err)
 		return
 	}
 
-	ratio, err := getVideoAspectRatio(temp.Name())
+	writeProgressEvent(w, flusher, "ffprobe", 0, 0)
+	ratio, err := cfg.getVideoAspectRatio(r.Context(), temp.Name())
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't get the videos aspect ratio", err)
+		writeErrorEvent(w, flusher, "ffprobe", err)
 		return
 	}
+	writeProgressEvent(w, flusher, "ffprobe", 1, 1)
 
 	var prefix string
 	switch ratio {
@@ -108,30 +118,36 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		prefix = "other"
 	}
 
-	fastStart, err := processVideoForFastStart(temp.Name())
+	writeProgressEvent(w, flusher, "faststart", 0, 0)
+	fastStart, err := cfg.processVideoForFastStart(r.Context(), temp.Name())
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't move flag to beggining", err)
+		writeErrorEvent(w, flusher, "faststart", err)
 		return
 	}
 	defer os.Remove(fastStart)
+	writeProgressEvent(w, flusher, "faststart", 1, 1)
 
 	processedFile, err := os.Open(fastStart)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't open processed file", err)
+		writeErrorEvent(w, flusher, "faststart", err)
 		return
 	}
 	defer processedFile.Close()
 
+	fileInfo, err := processedFile.Stat()
+	if err != nil {
+		writeErrorEvent(w, flusher, "s3-upload", err)
+		return
+	}
+
 	key := fmt.Sprintf("%s/%x.mp4", prefix, randBytes)
 
-	_, err = cfg.s3Client.PutObject(r.Context(), &s3.PutObjectInput{
-		Bucket:      aws.String(cfg.s3Bucket),
-		Key:         aws.String(key),
-		Body:        processedFile,
-		ContentType: aws.String(mediaType),
-	})
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't put object in bucket", err)
+	uploader := NewMultipartUploader(cfg.s3Client, cfg.s3Bucket, key, mediaType, cfg.s3PartSize, cfg.s3PartConcurrency)
+	s3Progress := &progressReader{r: processedFile, total: fileInfo.Size(), onProgress: func(bytesDone, bytesTotal int64) {
+		writeProgressEvent(w, flusher, "s3-upload", bytesDone, bytesTotal)
+	}}
+	if err := uploader.Upload(r.Context(), s3Progress, nil); err != nil {
+		writeErrorEvent(w, flusher, "s3-upload", err)
 		return
 	}
 
@@ -139,48 +155,89 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 
 	video.VideoURL = &s3URL
 
+	// Thumbnails are a nice-to-have: if ffmpeg can't produce one, the
+	// video upload should still succeed.
+	thumbnailURL, err := cfg.generateAndUploadThumbnail(r.Context(), fastStart, prefix, randBytes)
+	if err != nil {
+		log.Printf("couldn't generate thumbnail for video %s: %v", videoID, err)
+	} else {
+		video.ThumbnailURL = &thumbnailURL
+	}
+
+	spriteSheetURL, err := cfg.generateAndUploadSpriteSheet(r.Context(), fastStart, prefix, randBytes)
+	if err != nil {
+		log.Printf("couldn't generate sprite sheet for video %s: %v", videoID, err)
+	} else {
+		video.SpriteSheetURL = &spriteSheetURL
+	}
+
 	log.Printf("Saving before VideoURL: %+v", video.VideoURL)
 	err = cfg.db.UpdateVideo(video)
 	log.Printf("Saving after VideoURL: %+v", video.VideoURL)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't update video URL", err)
+		writeErrorEvent(w, flusher, "save", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, video)
+	enc := json.NewEncoder(w)
+	_ = enc.Encode(video)
+	if flusher != nil {
+		flusher.Flush()
+	}
 }
 
-type FFProbeOutput struct {
-	Streams []Stream `json:"streams"`
+// uploadProgressEvent is one line of the ndjson stream handlerUploadVideo
+// writes back to the client while it works through the copy, probe,
+// faststart and S3 phases of an upload.
+type uploadProgressEvent struct {
+	Stage      string  `json:"stage"`
+	BytesDone  int64   `json:"bytes_done"`
+	BytesTotal int64   `json:"bytes_total"`
+	Percent    float64 `json:"percent"`
 }
 
-type Stream struct {
-	Width  int `json:"width"`
-	Height int `json:"height"`
+func writeProgressEvent(w http.ResponseWriter, flusher http.Flusher, stage string, bytesDone, bytesTotal int64) {
+	var percent float64
+	if bytesTotal > 0 {
+		percent = float64(bytesDone) / float64(bytesTotal) * 100
+	}
+	_ = json.NewEncoder(w).Encode(uploadProgressEvent{
+		Stage:      stage,
+		BytesDone:  bytesDone,
+		BytesTotal: bytesTotal,
+		Percent:    percent,
+	})
+	if flusher != nil {
+		flusher.Flush()
+	}
 }
 
-func getVideoAspectRatio(filePath string) (string, error) {
-	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_streams", filePath)
-	var output bytes.Buffer
-	cmd.Stdout = &output
-
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("failed to run ffprobe: %w", err)
-	}
+// uploadErrorEvent is the ndjson line written when a stage fails after
+// the response has already started streaming, so we can't fall back to
+// respondWithError's status-code-plus-body shape.
+type uploadErrorEvent struct {
+	Stage string `json:"stage"`
+	Error string `json:"error"`
+}
 
-	var ffprobeData FFProbeOutput
-	if err := json.Unmarshal(output.Bytes(), &ffprobeData); err != nil {
-		return "", fmt.Errorf("failed to unmarshal json: %w", err)
+func writeErrorEvent(w http.ResponseWriter, flusher http.Flusher, stage string, err error) {
+	log.Printf("upload failed at stage %s: %v", stage, err)
+	_ = json.NewEncoder(w).Encode(uploadErrorEvent{Stage: stage, Error: err.Error()})
+	if flusher != nil {
+		flusher.Flush()
 	}
+}
 
-	if len(ffprobeData.Streams) == 0 {
-		return "", fmt.Errorf("no streams found in video")
+// getVideoAspectRatio probes filePath via cfg.ffmpeg and buckets its
+// width/height into one of the ratios the app knows how to prefix S3
+// keys with.
+func (cfg *apiConfig) getVideoAspectRatio(ctx context.Context, filePath string) (string, error) {
+	probe, err := cfg.ffmpeg.Probe(ctx, filePath)
+	if err != nil {
+		return "", err
 	}
 
-	width := ffprobeData.Streams[0].Width
-	height := ffprobeData.Streams[0].Height
-
-	ratio := float64(width) / float64(height)
+	ratio := float64(probe.Width) / float64(probe.Height)
 
 	const tolerance = 0.1
 
@@ -194,19 +251,11 @@ func getVideoAspectRatio(filePath string) (string, error) {
 
 }
 
-func processVideoForFastStart(filePath string) (string, error) {
-	if _, err := exec.LookPath("ffmpeg"); err != nil {
-		return "", fmt.Errorf("ffmpeg not found in PATH: %w", err)
-	}
+func (cfg *apiConfig) processVideoForFastStart(ctx context.Context, filePath string) (string, error) {
 	output := filePath + ".processing"
 
-	cmd := exec.Command("ffmpeg", "-i", filePath, "-c", "copy", "-movflags", "faststart", "-f", "mp4", output)
-
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("error processing video: %s, %v", stderr.String(), err)
+	if err := cfg.ffmpeg.Remux(ctx, filePath, output, "-i", filePath, "-c", "copy", "-movflags", "faststart", "-f", "mp4", output); err != nil {
+		return "", fmt.Errorf("error processing video: %w", err)
 	}
 
 	fileInfo, err := os.Stat(output)
@@ -219,3 +268,89 @@ func processVideoForFastStart(filePath string) (string, error) {
 
 	return output, nil
 }
+
+// generateAndUploadThumbnail grabs a single frame from the midpoint of
+// the video, scales it down to a 320px-wide poster, and uploads it to
+// the thumbnails/ prefix of the video bucket. It returns the public URL
+// of the uploaded thumbnail.
+func (cfg *apiConfig) generateAndUploadThumbnail(ctx context.Context, filePath, prefix string, randBytes []byte) (string, error) {
+	probe, err := cfg.ffmpeg.Probe(ctx, filePath)
+	if err != nil {
+		return "", fmt.Errorf("couldn't probe video for thumbnail: %w", err)
+	}
+
+	out := filePath + "-thumb.jpg"
+	defer os.Remove(out)
+
+	args := []string{
+		"-ss", fmt.Sprintf("%f", probe.Duration/2),
+		"-i", filePath,
+		"-vframes", "1",
+		"-vf", "scale=320:-2",
+		"-f", "image2",
+		out,
+	}
+	if err := cfg.ffmpeg.Remux(ctx, filePath, out, args...); err != nil {
+		return "", fmt.Errorf("ffmpeg thumbnail generation failed: %w", err)
+	}
+
+	return cfg.uploadPosterFrame(ctx, out, "thumbnails", prefix, randBytes, "")
+}
+
+// generateAndUploadSpriteSheet produces a 4x4 grid of evenly-spaced
+// frames from across the video, for use as a scrubbing preview, and
+// uploads it next to the thumbnail.
+func (cfg *apiConfig) generateAndUploadSpriteSheet(ctx context.Context, filePath, prefix string, randBytes []byte) (string, error) {
+	const cols, rows = 4, 4
+	probe, err := cfg.ffmpeg.Probe(ctx, filePath)
+	if err != nil {
+		return "", fmt.Errorf("couldn't probe video for sprite sheet: %w", err)
+	}
+
+	framesWanted := cols * rows
+	interval := probe.Duration / float64(framesWanted)
+	if interval <= 0 {
+		return "", fmt.Errorf("video too short to build a sprite sheet")
+	}
+
+	out := filePath + "-sprite.jpg"
+	defer os.Remove(out)
+
+	args := []string{
+		"-i", filePath,
+		"-vf", fmt.Sprintf("fps=1/%f,scale=160:-1,tile=%dx%d", interval, cols, rows),
+		"-frames:v", "1",
+		"-f", "image2",
+		out,
+	}
+	if err := cfg.ffmpeg.Remux(ctx, filePath, out, args...); err != nil {
+		return "", fmt.Errorf("ffmpeg sprite sheet generation failed: %w", err)
+	}
+
+	return cfg.uploadPosterFrame(ctx, out, "thumbnails", prefix, randBytes, "-sprite")
+}
+
+// uploadPosterFrame uploads a generated JPEG (thumbnail or sprite sheet)
+// to the S3 bucket under "{folder}/{prefix}/{randhex}{suffix}.jpg" and
+// returns its public URL.
+func (cfg *apiConfig) uploadPosterFrame(ctx context.Context, localPath, folder, prefix string, randBytes []byte, suffix string) (string, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return "", fmt.Errorf("couldn't open generated image: %w", err)
+	}
+	defer f.Close()
+
+	key := fmt.Sprintf("%s/%s/%x%s.jpg", folder, prefix, randBytes, suffix)
+
+	_, err = cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(cfg.s3Bucket),
+		Key:         aws.String(key),
+		Body:        f,
+		ContentType: aws.String("image/jpeg"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("couldn't put image in bucket: %w", err)
+	}
+
+	return fmt.Sprintf("%s/%s", cfg.s3CfDistribution, key), nil
+}
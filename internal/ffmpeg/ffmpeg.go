@@ -0,0 +1,18 @@
+// Package ffmpeg gives the rest of the app a small, dependency-free
+// surface over ffmpeg/ffprobe: Probe and Remux. The default build shells
+// out to a system ffmpeg/ffprobe install via os/exec. Building with the
+// ffmpegwasm tag switches to running both in-process against embedded
+// WebAssembly builds via wazero instead, so uploads don't fork a
+// subprocess or require a system ffmpeg install - that path needs the
+// ffmpeg/ffprobe WASM binaries vendored under internal/ffmpeg/bin/,
+// which aren't checked into this tree yet.
+package ffmpeg
+
+// ProbeResult is the subset of ffprobe's output callers need: enough to
+// pick an aspect-ratio bucket and to build an HLS ladder that never
+// upscales past the source.
+type ProbeResult struct {
+	Width    int
+	Height   int
+	Duration float64 // seconds
+}
@@ -0,0 +1,90 @@
+//go:build !ffmpegwasm
+
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// Runtime shells out to a system ffmpeg/ffprobe install. This is the
+// default build: the wazero-backed Runtime in runtime_wasm.go needs the
+// ffmpeg/ffprobe WASM blobs embedded under bin/, which aren't vendored
+// into this tree yet, so it's opt-in behind -tags ffmpegwasm until
+// they are.
+type Runtime struct{}
+
+// New ignores cacheDir; there's nothing to compile when shelling out.
+func New(ctx context.Context, cacheDir string) (*Runtime, error) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return nil, fmt.Errorf("ffmpeg: ffmpeg not found in PATH: %w", err)
+	}
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		return nil, fmt.Errorf("ffmpeg: ffprobe not found in PATH: %w", err)
+	}
+	return &Runtime{}, nil
+}
+
+// Close is a no-op; there's no runtime to tear down.
+func (r *Runtime) Close(ctx context.Context) error {
+	return nil
+}
+
+// Probe shells out to ffprobe and returns the source's width, height
+// and duration.
+func (r *Runtime) Probe(ctx context.Context, path string) (*ProbeResult, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-print_format", "json", "-show_streams", "-show_format", path)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: probe failed: %w", err)
+	}
+
+	var out struct {
+		Streams []struct {
+			Width  int `json:"width"`
+			Height int `json:"height"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return nil, fmt.Errorf("ffmpeg: couldn't unmarshal probe output: %w", err)
+	}
+	if len(out.Streams) == 0 {
+		return nil, fmt.Errorf("ffmpeg: no streams found in %s", path)
+	}
+
+	duration, err := strconv.ParseFloat(out.Format.Duration, 64)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg: couldn't parse duration: %w", err)
+	}
+
+	return &ProbeResult{Width: out.Streams[0].Width, Height: out.Streams[0].Height, Duration: duration}, nil
+}
+
+// Remux shells out to ffmpeg with args appended verbatim, e.g. for
+// faststart remuxing or thumbnail extraction. args is expected to
+// reference in/out by their real paths itself (mirroring the wasm
+// Runtime's contract), so it already includes "-i", in.
+func (r *Runtime) Remux(ctx context.Context, in, out string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg: remux failed: %s: %w", stderr.String(), err)
+	}
+
+	if _, err := os.Stat(out); err != nil {
+		return fmt.Errorf("ffmpeg: expected output %s was not produced: %w", out, err)
+	}
+	return nil
+}
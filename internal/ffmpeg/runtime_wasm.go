@@ -0,0 +1,152 @@
+//go:build ffmpegwasm
+
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+//go:embed bin/ffmpeg.wasm
+var ffmpegWASM []byte
+
+//go:embed bin/ffprobe.wasm
+var ffprobeWASM []byte
+
+// Runtime hosts compiled ffmpeg/ffprobe WASM modules in a shared wazero
+// runtime. The modules are compiled once at startup (cached on disk so
+// restarts skip recompilation); each Probe/Remux call then only pays for
+// instantiating a fresh module instance, not a fork+exec.
+type Runtime struct {
+	rt      wazero.Runtime
+	ffmpeg  wazero.CompiledModule
+	ffprobe wazero.CompiledModule
+}
+
+// New compiles the embedded ffmpeg/ffprobe modules into a shared
+// wazero.Runtime, using cacheDir to persist compiled artifacts across
+// process restarts.
+func New(ctx context.Context, cacheDir string) (*Runtime, error) {
+	cache, err := wazero.NewCompilationCacheWithDir(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg: couldn't create compilation cache: %w", err)
+	}
+
+	rt := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCompilationCache(cache))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, rt); err != nil {
+		return nil, fmt.Errorf("ffmpeg: couldn't instantiate WASI: %w", err)
+	}
+
+	ffmpegMod, err := rt.CompileModule(ctx, ffmpegWASM)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg: couldn't compile ffmpeg module: %w", err)
+	}
+
+	ffprobeMod, err := rt.CompileModule(ctx, ffprobeWASM)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg: couldn't compile ffprobe module: %w", err)
+	}
+
+	return &Runtime{rt: rt, ffmpeg: ffmpegMod, ffprobe: ffprobeMod}, nil
+}
+
+// Close tears down the shared wazero runtime and everything compiled
+// into it. Call it once, at process shutdown.
+func (r *Runtime) Close(ctx context.Context) error {
+	return r.rt.Close(ctx)
+}
+
+// Probe runs ffprobe against path inside a fresh module instance that
+// can only see path's directory, and returns its width, height and
+// duration.
+func (r *Runtime) Probe(ctx context.Context, path string) (*ProbeResult, error) {
+	var stdout bytes.Buffer
+	args := []string{"ffprobe", "-v", "error", "-print_format", "json", "-show_streams", "-show_format", filepath.Base(path)}
+
+	if err := r.run(ctx, r.ffprobe, filepath.Dir(path), args, &stdout); err != nil {
+		return nil, fmt.Errorf("ffmpeg: probe failed: %w", err)
+	}
+
+	var out struct {
+		Streams []struct {
+			Width  int `json:"width"`
+			Height int `json:"height"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return nil, fmt.Errorf("ffmpeg: couldn't unmarshal probe output: %w", err)
+	}
+	if len(out.Streams) == 0 {
+		return nil, fmt.Errorf("ffmpeg: no streams found in %s", path)
+	}
+
+	duration, err := strconv.ParseFloat(out.Format.Duration, 64)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg: couldn't parse duration: %w", err)
+	}
+
+	return &ProbeResult{Width: out.Streams[0].Width, Height: out.Streams[0].Height, Duration: duration}, nil
+}
+
+// Remux instantiates the ffmpeg module with the directory containing in
+// and out mounted into the guest. Callers pass args referencing in/out
+// by their real (host-absolute) paths, same as they'd hand to
+// exec.Command; Remux rewrites those occurrences to the basenames the
+// guest actually sees under /work before running, since only
+// filepath.Dir(in) is mounted. in and out must live in the same
+// directory.
+func (r *Runtime) Remux(ctx context.Context, in, out string, args ...string) error {
+	dir := filepath.Dir(in)
+	fullArgs := make([]string, 0, len(args)+1)
+	fullArgs = append(fullArgs, "ffmpeg")
+	for _, a := range args {
+		switch a {
+		case in:
+			a = filepath.Base(in)
+		case out:
+			a = filepath.Base(out)
+		}
+		fullArgs = append(fullArgs, a)
+	}
+
+	if err := r.run(ctx, r.ffmpeg, dir, fullArgs, nil); err != nil {
+		return fmt.Errorf("ffmpeg: remux failed: %w", err)
+	}
+
+	if _, err := os.Stat(out); err != nil {
+		return fmt.Errorf("ffmpeg: expected output %s was not produced: %w", out, err)
+	}
+	return nil
+}
+
+// run instantiates mod fresh against workDir - wazero module instances
+// aren't safe to reuse across concurrent invocations, so every call gets
+// its own.
+func (r *Runtime) run(ctx context.Context, mod wazero.CompiledModule, workDir string, argv []string, stdout *bytes.Buffer) error {
+	fsConfig := wazero.NewFSConfig().WithDirMount(workDir, "/work")
+
+	modCfg := wazero.NewModuleConfig().
+		WithArgs(argv...).
+		WithFSConfig(fsConfig)
+	if stdout != nil {
+		modCfg = modCfg.WithStdout(stdout)
+	}
+
+	instance, err := r.rt.InstantiateModule(ctx, mod, modCfg)
+	if err != nil {
+		return err
+	}
+	return instance.Close(ctx)
+}
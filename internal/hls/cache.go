@@ -0,0 +1,66 @@
+package hls
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// CacheBudgetBytes is the maximum amount of disk space the local chunk
+// cache is allowed to occupy before EvictLRU starts reclaiming space.
+const CacheBudgetBytes = 5 << 30 // 5 GiB
+
+// EvictLRU walks cacheDir and deletes the least-recently-accessed chunk
+// files until the total cache size is back under CacheBudgetBytes. A
+// file's mtime stands for its last access. startJanitorOnce runs it
+// periodically on a background ticker.
+func EvictLRU(cacheDir string) error {
+	return evictLRU(cacheDir, CacheBudgetBytes)
+}
+
+// evictLRU is EvictLRU with the budget threshold broken out as a
+// parameter so tests can exercise eviction without writing gigabytes of
+// scratch files.
+func evictLRU(cacheDir string, budget int64) error {
+	type entry struct {
+		path    string
+		size    int64
+		accesed time.Time
+	}
+
+	var entries []entry
+	var total int64
+
+	err := filepath.Walk(cacheDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		entries = append(entries, entry{path: path, size: info.Size(), accesed: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if total <= budget {
+		return nil
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].accesed.Before(entries[j].accesed)
+	})
+
+	for _, e := range entries {
+		if total <= budget {
+			break
+		}
+		if err := os.Remove(e.path); err != nil {
+			continue
+		}
+		total -= e.size
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package hls
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEvictLRU(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name string, size int, mtime time.Time) {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+			t.Fatalf("couldn't write %s: %v", name, err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("couldn't set mtime for %s: %v", name, err)
+		}
+	}
+
+	now := time.Now()
+	write("oldest.ts", 10, now.Add(-2*time.Hour))
+	write("middle.ts", 10, now.Add(-1*time.Hour))
+	write("newest.ts", 10, now)
+
+	// Budget only leaves room for one of the three 10-byte files, so
+	// eviction should walk oldest-to-newest until it fits.
+	if err := evictLRU(dir, 10); err != nil {
+		t.Fatalf("evictLRU: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "oldest.ts")); !os.IsNotExist(err) {
+		t.Errorf("oldest.ts should have been evicted first, got err=%v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "middle.ts")); !os.IsNotExist(err) {
+		t.Errorf("middle.ts should have been evicted next, got err=%v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "newest.ts")); err != nil {
+		t.Errorf("newest.ts should have survived eviction, got err=%v", err)
+	}
+}
+
+func TestEvictLRUUnderBudget(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "chunk-0.ts")
+	if err := os.WriteFile(path, []byte("small"), 0o644); err != nil {
+		t.Fatalf("couldn't write file: %v", err)
+	}
+
+	if err := evictLRU(dir, CacheBudgetBytes); err != nil {
+		t.Fatalf("evictLRU: %v", err)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("file under budget should not be evicted, got err=%v", err)
+	}
+}
@@ -0,0 +1,247 @@
+// Package hls manages on-demand per-resolution transcoding of uploaded
+// videos into HLS chunks. Each (videoID, quality) pair gets its own
+// Manager that runs ffmpeg once per chunk as chunks are requested,
+// caches them to local disk, and drops out of the registry after a
+// period of inactivity. No ffmpeg process outlives the chunk request
+// that started it.
+package hls
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Quality is one rung of the adaptive bitrate ladder.
+type Quality struct {
+	Name    string // e.g. "720p"
+	Width   int
+	Height  int
+	Bitrate string // e.g. "2800k", passed straight to ffmpeg's -b:v
+}
+
+// Ladder is the full set of tiers we're willing to produce, ordered from
+// lowest to highest. BuildLadder trims this down to whatever fits under
+// the source video's height.
+var Ladder = []Quality{
+	{Name: "360p", Width: 640, Height: 360, Bitrate: "800k"},
+	{Name: "480p", Width: 854, Height: 480, Bitrate: "1400k"},
+	{Name: "720p", Width: 1280, Height: 720, Bitrate: "2800k"},
+	{Name: "1080p", Width: 1920, Height: 1080, Bitrate: "5000k"},
+	{Name: "1440p", Width: 2560, Height: 1440, Bitrate: "9000k"},
+	{Name: "2160p", Width: 3840, Height: 2160, Bitrate: "18000k"},
+}
+
+// BuildLadder returns every tier in Ladder whose height does not exceed
+// the source video's height, so we never upscale.
+func BuildLadder(sourceHeight int) []Quality {
+	var tiers []Quality
+	for _, q := range Ladder {
+		if q.Height <= sourceHeight {
+			tiers = append(tiers, q)
+		}
+	}
+	return tiers
+}
+
+// ChunkDuration is the fixed length, in seconds, of each HLS chunk.
+const ChunkDuration = 3
+
+// idleTimeout is how long a Manager stays registered after its last
+// chunk request before evict removes it. It stops no ffmpeg process:
+// each transcode runs to completion inside its Chunk call.
+const idleTimeout = 2 * time.Minute
+
+// NumChunks returns how many ChunkDuration-sized chunks a video of the
+// given duration (in seconds) splits into, and never less than 1.
+// Callers use this both to build variant playlists and to reject chunk
+// requests past the end of the video before paying for a transcode.
+func NumChunks(duration float64) int {
+	n := int(math.Ceil(duration / ChunkDuration))
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// Manager owns the lazily-transcoded chunks for one (videoID, quality)
+// pair. Chunks are produced on demand, one ffmpeg run per chunk, and
+// cached to cacheDir; an inactivity timer removes the Manager from the
+// registry once requests stop coming in. The timer does not stop an
+// ffmpeg run that is already in progress.
+type Manager struct {
+	videoID   string
+	quality   Quality
+	sourceURL string
+	cacheDir  string
+
+	mu      sync.Mutex
+	chunkMu map[int]*sync.Mutex
+	timer   *time.Timer
+	closed  bool
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]*Manager{}
+
+	janitorOnce sync.Once
+)
+
+// janitorInterval is how often the background job sweeps the local HLS
+// chunk cache for EvictLRU.
+const janitorInterval = 10 * time.Minute
+
+func key(videoID, quality string) string {
+	return videoID + "/" + quality
+}
+
+// GetManager returns the Manager for (videoID, quality), creating one
+// backed by cacheDir if it doesn't exist yet. The first call also starts
+// the background job that keeps cacheDir under CacheBudgetBytes via
+// EvictLRU - there's no separate process entry point to wire it into,
+// so it piggybacks on the same on-demand startup as the Managers
+// themselves.
+func GetManager(videoID, sourceURL, cacheDir string, quality Quality) *Manager {
+	startJanitorOnce(cacheDir)
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	k := key(videoID, quality.Name)
+	if m, ok := registry[k]; ok {
+		return m
+	}
+
+	m := &Manager{
+		videoID:   videoID,
+		quality:   quality,
+		sourceURL: sourceURL,
+		cacheDir:  filepath.Join(cacheDir, videoID, quality.Name),
+		chunkMu:   map[int]*sync.Mutex{},
+	}
+	registry[k] = m
+	return m
+}
+
+// startJanitorOnce launches the periodic EvictLRU sweep over rootCacheDir.
+// It only ever runs once per process.
+func startJanitorOnce(rootCacheDir string) {
+	janitorOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(janitorInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if err := EvictLRU(rootCacheDir); err != nil {
+					log.Printf("hls: cache eviction failed: %v", err)
+				}
+			}
+		}()
+	})
+}
+
+// Chunk returns the path to the transcoded .ts file for chunk n,
+// transcoding it first if it isn't already cached on disk. Requests for
+// different chunks of the same (videoID, quality) run concurrently; only
+// requests for the *same* chunk number are serialized, so one slow
+// transcode doesn't stall unrelated chunks.
+func (m *Manager) Chunk(n int) (string, error) {
+	chunkLock, err := m.lockChunk(n)
+	if err != nil {
+		return "", err
+	}
+	defer chunkLock.Unlock()
+
+	if err := os.MkdirAll(m.cacheDir, 0o755); err != nil {
+		return "", fmt.Errorf("hls: couldn't create cache dir: %w", err)
+	}
+
+	chunkPath := filepath.Join(m.cacheDir, fmt.Sprintf("chunk-%d.ts", n))
+	if _, err := os.Stat(chunkPath); err == nil {
+		// EvictLRU orders chunks by mtime, so refresh it on every hit.
+		now := time.Now()
+		_ = os.Chtimes(chunkPath, now, now)
+		m.resetTimer()
+		return chunkPath, nil
+	}
+
+	if err := m.transcodeChunk(n, chunkPath); err != nil {
+		return "", err
+	}
+
+	m.resetTimer()
+	return chunkPath, nil
+}
+
+// lockChunk returns the (created on first use) mutex guarding chunk n and
+// locks it, leaving the caller responsible for unlocking. m.mu is only
+// held long enough to get-or-create that per-chunk mutex, not for the
+// transcode itself, so waiting on one chunk never blocks lookups for
+// others.
+func (m *Manager) lockChunk(n int) (*sync.Mutex, error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("hls: manager for %s/%s is closed", m.videoID, m.quality.Name)
+	}
+	cl, ok := m.chunkMu[n]
+	if !ok {
+		cl = &sync.Mutex{}
+		m.chunkMu[n] = cl
+	}
+	m.mu.Unlock()
+
+	cl.Lock()
+	return cl, nil
+}
+
+func (m *Manager) transcodeChunk(n int, outPath string) error {
+	offset := n * ChunkDuration
+	cmd := exec.Command("ffmpeg",
+		"-ss", fmt.Sprintf("%d", offset),
+		"-i", m.sourceURL,
+		"-t", fmt.Sprintf("%d", ChunkDuration),
+		"-c:v", "libx264",
+		"-vf", fmt.Sprintf("scale=%d:%d", m.quality.Width, m.quality.Height),
+		"-b:v", m.quality.Bitrate,
+		"-c:a", "aac",
+		"-f", "mpegts",
+		outPath,
+	)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("hls: ffmpeg failed for %s/%s chunk %d: %s: %w", m.videoID, m.quality.Name, n, stderr.String(), err)
+	}
+	return nil
+}
+
+// resetTimer restarts the inactivity timer.
+func (m *Manager) resetTimer() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	m.timer = time.AfterFunc(idleTimeout, m.evict)
+}
+
+// evict removes this Manager from the registry once it's gone idle. It
+// does not delete cached chunks on disk - eviction of those is handled
+// separately by the LRU disk cache janitor.
+func (m *Manager) evict() {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	delete(registry, key(m.videoID, m.quality.Name))
+}
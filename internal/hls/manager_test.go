@@ -0,0 +1,52 @@
+package hls
+
+import "testing"
+
+func TestBuildLadder(t *testing.T) {
+	tests := []struct {
+		name         string
+		sourceHeight int
+		want         []string
+	}{
+		{"below lowest tier", 240, nil},
+		{"exact match on a tier boundary", 1080, []string{"360p", "480p", "720p", "1080p"}},
+		{"above the top tier", 4000, []string{"360p", "480p", "720p", "1080p", "1440p", "2160p"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BuildLadder(tt.sourceHeight)
+			if len(got) != len(tt.want) {
+				t.Fatalf("BuildLadder(%d) = %v, want %v", tt.sourceHeight, got, tt.want)
+			}
+			for i, q := range got {
+				if q.Name != tt.want[i] {
+					t.Errorf("BuildLadder(%d)[%d] = %q, want %q", tt.sourceHeight, i, q.Name, tt.want[i])
+				}
+				if q.Height > tt.sourceHeight {
+					t.Errorf("BuildLadder(%d) included %q, which would upscale", tt.sourceHeight, q.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestNumChunks(t *testing.T) {
+	tests := []struct {
+		duration float64
+		want     int
+	}{
+		{0, 1},
+		{1, 1},
+		{ChunkDuration - 0.01, 1},
+		{ChunkDuration, 1},
+		{ChunkDuration + 0.01, 2},
+		{10 * ChunkDuration, 10},
+	}
+
+	for _, tt := range tests {
+		if got := NumChunks(tt.duration); got != tt.want {
+			t.Errorf("NumChunks(%v) = %d, want %d", tt.duration, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// defaultPartSize and defaultPartConcurrency are used when apiConfig
+// doesn't override them. 10 MiB sits comfortably inside S3's part-size
+// window (5 MiB-5 GiB) without producing too many parts for a 1 GiB
+// upload.
+const (
+	defaultPartSize        = 10 << 20
+	defaultPartConcurrency = 4
+)
+
+// MultipartUploader uploads a single object to S3 as a set of
+// concurrently-uploaded parts rather than one long-running PutObject, so
+// large files don't bottleneck on a single connection.
+type MultipartUploader struct {
+	client      *s3.Client
+	bucket      string
+	key         string
+	contentType string
+	partSize    int64
+	concurrency int
+}
+
+// NewMultipartUploader builds an uploader for bucket/key. A partSize or
+// concurrency of 0 falls back to the package defaults.
+func NewMultipartUploader(client *s3.Client, bucket, key, contentType string, partSize int64, concurrency int) *MultipartUploader {
+	if partSize <= 0 {
+		partSize = defaultPartSize
+	}
+	if concurrency <= 0 {
+		concurrency = defaultPartConcurrency
+	}
+	return &MultipartUploader{
+		client:      client,
+		bucket:      bucket,
+		key:         key,
+		contentType: contentType,
+		partSize:    partSize,
+		concurrency: concurrency,
+	}
+}
+
+type uploadedPart struct {
+	num  int32
+	etag *string
+}
+
+// Upload reads r to completion, splitting it into u.partSize chunks and
+// uploading up to u.concurrency of them at a time. If anything fails
+// partway through, the in-progress multipart upload is aborted so S3
+// doesn't keep billing for orphaned parts. onProgress, if non-nil, is
+// called after each part finishes uploading with the cumulative bytes
+// sent so far.
+func (u *MultipartUploader) Upload(ctx context.Context, r io.Reader, onProgress func(bytesDone int64)) error {
+	created, err := u.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(u.bucket),
+		Key:         aws.String(u.key),
+		ContentType: aws.String(u.contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("multipart: couldn't create upload: %w", err)
+	}
+	uploadID := created.UploadId
+
+	abort := func() {
+		_, _ = u.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(u.bucket),
+			Key:      aws.String(u.key),
+			UploadId: uploadID,
+		})
+	}
+
+	type job struct {
+		num  int32
+		data []byte
+	}
+
+	// partsCtx is canceled the moment any part upload fails, so a failure
+	// on part 1 of a 1 GiB file stops the producer and every other
+	// worker immediately instead of uploading the rest of the file first.
+	partsCtx, cancelParts := context.WithCancel(ctx)
+	defer cancelParts()
+
+	jobs := make(chan job)
+	results := make(chan uploadedPart)
+	errs := make(chan error, u.concurrency)
+
+	var sentMu sync.Mutex
+	var sent int64
+
+	var wg sync.WaitGroup
+	for i := 0; i < u.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if partsCtx.Err() != nil {
+					continue
+				}
+				out, err := u.client.UploadPart(partsCtx, &s3.UploadPartInput{
+					Bucket:     aws.String(u.bucket),
+					Key:        aws.String(u.key),
+					UploadId:   uploadID,
+					PartNumber: aws.Int32(j.num),
+					Body:       bytes.NewReader(j.data),
+				})
+				if err != nil {
+					select {
+					case errs <- fmt.Errorf("multipart: couldn't upload part %d: %w", j.num, err):
+					default:
+						log.Printf("multipart: dropped error for part %d (already failing): %v", j.num, err)
+					}
+					cancelParts()
+					continue
+				}
+				results <- uploadedPart{num: j.num, etag: out.ETag}
+				if onProgress != nil {
+					sentMu.Lock()
+					sent += int64(len(j.data))
+					onProgress(sent)
+					sentMu.Unlock()
+				}
+			}
+		}()
+	}
+
+	var parts []uploadedPart
+	done := make(chan struct{})
+	go func() {
+		for p := range results {
+			parts = append(parts, p)
+		}
+		close(done)
+	}()
+
+	var partNum int32 = 1
+	readErr := func() error {
+		defer close(jobs)
+		buf := make([]byte, u.partSize)
+		for {
+			n, err := io.ReadFull(r, buf)
+			if n > 0 {
+				data := make([]byte, n)
+				copy(data, buf[:n])
+				select {
+				case jobs <- job{num: partNum, data: data}:
+					partNum++
+				case <-partsCtx.Done():
+					return nil
+				}
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("multipart: couldn't read source: %w", err)
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(results)
+	<-done
+
+	if readErr != nil {
+		abort()
+		return readErr
+	}
+	select {
+	case err := <-errs:
+		abort()
+		return err
+	default:
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].num < parts[j].num })
+
+	completed := make([]types.CompletedPart, len(parts))
+	for i, p := range parts {
+		completed[i] = types.CompletedPart{ETag: p.etag, PartNumber: aws.Int32(p.num)}
+	}
+
+	_, err = u.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(u.bucket),
+		Key:             aws.String(u.key),
+		UploadId:        uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		abort()
+		return fmt.Errorf("multipart: couldn't complete upload: %w", err)
+	}
+
+	return nil
+}
+
+// progressReader wraps an io.Reader and calls onProgress after every Read
+// with the cumulative number of bytes consumed and the expected total,
+// so callers can stream upload progress back to a client.
+type progressReader struct {
+	r          io.Reader
+	total      int64
+	bytesRead  int64
+	onProgress func(bytesRead, total int64)
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	if n > 0 {
+		p.bytesRead += int64(n)
+		if p.onProgress != nil {
+			p.onProgress(p.bytesRead, p.total)
+		}
+	}
+	return n, err
+}